@@ -0,0 +1,256 @@
+// Copyright 2021 Changkun Ou. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	imapclient "github.com/emersion/go-imap/client"
+)
+
+// todoSubjectPrefix is the subject prefix newTODO already uses, so the
+// daemon knows which inbox messages are replies to a TODO it sent.
+const todoSubjectPrefix = "todo: "
+
+// defaultPollInterval is used when conf.PollIntervalSec is unset.
+const defaultPollInterval = 60 * time.Second
+
+// taskState is the lifecycle state of a TODO reconciled from a reply.
+type taskState string
+
+const (
+	taskOpen     taskState = "open"
+	taskDone     taskState = "done"
+	taskSnoozed  taskState = "snoozed"
+	taskCanceled taskState = "canceled"
+)
+
+// task is a TODO reconciled from an inbox reply.
+type task struct {
+	Subject string    `json:"subject"`
+	State   taskState `json:"state"`
+	Snoozed time.Time `json:"snoozed,omitempty"`
+}
+
+// taskStorePath persists reconciled tasks between poll cycles and daemon
+// restarts.
+var taskStorePath = filepath.Join(os.Getenv("HOME"), ".todo", "tasks.json")
+
+// taskStore is a mutex-guarded map of reconciled tasks, keyed by subject
+// line, periodically flushed to taskStorePath.
+type taskStore struct {
+	mu    sync.Mutex
+	tasks map[string]*task
+}
+
+func newTaskStore() *taskStore {
+	return &taskStore{tasks: make(map[string]*task)}
+}
+
+// loadTaskStore reads a taskStore previously persisted by save, or an
+// empty one if none exists yet.
+func loadTaskStore() (*taskStore, error) {
+	s := newTaskStore()
+	b, err := os.ReadFile(taskStorePath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []*task
+	if err := json.Unmarshal(b, &tasks); err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		s.tasks[t.Subject] = t
+	}
+	return s, nil
+}
+
+// save persists the current state of every reconciled task to disk, so a
+// daemon restart (or the next poll cycle) can pick up where this one left
+// off.
+func (s *taskStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := make([]*task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(taskStorePath), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(tasks)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(taskStorePath, b, 0o644)
+}
+
+func (s *taskStore) upsert(subject string) *task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[subject]
+	if !ok {
+		t = &task{Subject: subject, State: taskOpen}
+		s.tasks[subject] = t
+	}
+	return t
+}
+
+// runDaemon starts a long-running IMAP polling loop that watches the
+// inbox for replies to TODOs sent by newTODO, and reconciles them into a
+// local task store until it receives an interrupt signal.
+func runDaemon(ctx context.Context) error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+
+	interval := defaultPollInterval
+	if conf.PollIntervalSec > 0 {
+		interval = time.Duration(conf.PollIntervalSec) * time.Second
+	}
+
+	store, err := loadTaskStore()
+	if err != nil {
+		return fmt.Errorf("load task store: %w", err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Fprintf(os.Stdout, "todo: daemon started, polling %s every %s\n", conf.IMAPHost, interval)
+	for {
+		select {
+		case <-sigCh:
+			fmt.Fprintf(os.Stdout, "todo: daemon shutting down\n")
+			return nil
+		case <-ticker.C:
+			if err := reconcileOnce(store); err != nil {
+				fmt.Fprintf(os.Stderr, "todo: daemon: reconcile failed: %v\n", err)
+				continue
+			}
+			if err := store.save(); err != nil {
+				fmt.Fprintf(os.Stderr, "todo: daemon: failed to persist task store: %v\n", err)
+			}
+		}
+	}
+}
+
+// reconcileOnce connects to the configured IMAP mailbox, fetches every
+// unseen message, dispatches those whose subject carries the todo: prefix
+// to the matching state-mutating handler, and marks all fetched messages
+// as seen, including ones without the prefix.
+func reconcileOnce(store *taskStore) error {
+	c, err := imapclient.DialTLS(conf.IMAPHost, nil)
+	if err != nil {
+		return fmt.Errorf("dial imap: %w", err)
+	}
+	defer c.Logout()
+
+	if err := c.Login(conf.IMAPUser, conf.IMAPPassword); err != nil {
+		return fmt.Errorf("login imap: %w", err)
+	}
+	if _, err := c.Select("INBOX", false); err != nil {
+		return fmt.Errorf("select inbox: %w", err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	ids, err := c.Search(criteria)
+	if err != nil {
+		return fmt.Errorf("search unseen: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(ids...)
+
+	// BODY[TEXT] is the message body without its header block, so the
+	// reply's keywords come first.
+	section := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.TextSpecifier}}
+	messages := make(chan *imap.Message, len(ids))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchEnvelope, section.FetchItem()}, messages)
+	}()
+
+	for msg := range messages {
+		subject := msg.Envelope.Subject
+		if !strings.HasPrefix(subject, todoSubjectPrefix) {
+			continue
+		}
+		dispatch(store, subject, readBody(msg, section))
+	}
+	if err := <-done; err != nil {
+		return fmt.Errorf("fetch unseen: %w", err)
+	}
+
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	return c.Store(seqset, item, []any{imap.SeenFlag}, nil)
+}
+
+func readBody(msg *imap.Message, section *imap.BodySectionName) string {
+	r := msg.GetBody(section)
+	if r == nil {
+		return ""
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// dispatch mutates the stored task's state for subject based on keywords
+// found in the reply body: done, snooze <duration> (e.g. "snooze 3d"), or
+// cancel.
+func dispatch(store *taskStore, subject, body string) {
+	t := store.upsert(subject)
+	body = strings.ToLower(strings.TrimSpace(body))
+	switch {
+	case strings.HasPrefix(body, "snooze"):
+		d, err := parseSnoozeDuration(strings.TrimPrefix(body, "snooze"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "todo: daemon: %q: %v\n", subject, err)
+			return
+		}
+		t.State = taskSnoozed
+		t.Snoozed = time.Now().Add(d)
+	case strings.Contains(body, "cancel"):
+		t.State = taskCanceled
+	case strings.Contains(body, "done"):
+		t.State = taskDone
+	}
+}
+
+// parseSnoozeDuration parses durations like "3d" in addition to anything
+// time.ParseDuration already understands.
+func parseSnoozeDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(strings.TrimSpace(days))
+		if err != nil {
+			return 0, fmt.Errorf("invalid snooze duration %q: %w", s, err)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 Changkun Ou. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v4"
+)
+
+// minSTOHours and maxSTOHours bound the hours Mailgun's Send Time
+// Optimization accepts for o:deliverytime-optimize-period.
+const (
+	minSTOHours = 24
+	maxSTOHours = 72
+)
+
+// Message wraps a mailgun.Message with deferred delivery and Send Time
+// Optimization options that aren't part of mg.NewMessage.
+type Message struct {
+	*mailgun.Message
+	deliveryTime time.Time
+	stoPeriod    string
+}
+
+// validateSTOPeriod checks that period looks like "<N>h", with N within
+// Mailgun's accepted STO range.
+func validateSTOPeriod(period string) error {
+	hours, ok := strings.CutSuffix(period, "h")
+	if !ok {
+		return fmt.Errorf("sto period must look like \"48h\", got %q", period)
+	}
+	n, err := strconv.Atoi(hours)
+	if err != nil {
+		return fmt.Errorf("sto period must look like \"48h\", got %q", period)
+	}
+	if n < minSTOHours || n > maxSTOHours {
+		return fmt.Errorf("sto period must be between %dh and %dh, got %q", minSTOHours, maxSTOHours, period)
+	}
+	return nil
+}
+
+// applyDelivery sets Mailgun's deferred-delivery and Send Time
+// Optimization headers on m, if configured.
+func (m *Message) applyDelivery() error {
+	if !m.deliveryTime.IsZero() {
+		m.SetDeliveryTime(m.deliveryTime)
+	}
+	if m.stoPeriod != "" {
+		if err := validateSTOPeriod(m.stoPeriod); err != nil {
+			return err
+		}
+		m.AddHeader("o:deliverytime-optimize-period", m.stoPeriod)
+	}
+	return nil
+}
+
+// parseDeliverAt resolves the --at/--in flags into a single delivery time.
+// Both empty means send immediately. It is an error to set both.
+func parseDeliverAt(at string, in time.Duration) (time.Time, error) {
+	if at != "" && in != 0 {
+		return time.Time{}, fmt.Errorf("--at and --in are mutually exclusive")
+	}
+	if at != "" {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("--at must be RFC3339, got %q: %w", at, err)
+		}
+		return t, nil
+	}
+	if in != 0 {
+		return time.Now().Add(in), nil
+	}
+	return time.Time{}, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 Changkun Ou. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// historyPath records every TODO this CLI has sent, so the digest
+// subcommand can find what's new since its last run.
+var historyPath = filepath.Join(os.Getenv("HOME"), ".todo", "history.jsonl")
+
+// digestStorePath tracks which history entries were already folded into a
+// previous digest.
+var digestStorePath = filepath.Join(os.Getenv("HOME"), ".todo", "digest.json")
+
+// historyEntry is one line of historyPath.
+type historyEntry struct {
+	Subject   string    `json:"subject"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// recordSent appends a sent TODO to the local history log.
+func recordSent(subject, text string, createdAt time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(historyPath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := json.Marshal(historyEntry{Subject: subject, Text: text, CreatedAt: createdAt})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// readHistory returns every history entry created after since.
+func readHistory(since time.Time) ([]historyEntry, error) {
+	f, err := os.Open(historyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e historyEntry
+		if json.Unmarshal(s.Bytes(), &e) != nil {
+			continue
+		}
+		if e.CreatedAt.After(since) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, s.Err()
+}
+
+// digestSentStore tracks which history entries, keyed by historyKey, were
+// already folded into a previous digest. A flat JSON file is a deliberate
+// trade-off over BoltDB/SQLite: the whole set is just a membership check
+// over a handful of keys per run, and a file matches how taskStore persists
+// the daemon's state, so the CLI doesn't pull in a database dependency for
+// two small maps.
+type digestSentStore struct {
+	Sent map[string]bool `json:"sent"`
+}
+
+func loadDigestSentStore() (*digestSentStore, error) {
+	s := &digestSentStore{Sent: make(map[string]bool)}
+	b, err := os.ReadFile(digestStorePath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *digestSentStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(digestStorePath), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(digestStorePath, b, 0o644)
+}
+
+func historyKey(e historyEntry) string {
+	return e.Subject + "@" + e.CreatedAt.Format(time.RFC3339Nano)
+}
+
+// runDigest implements the `todo digest` subcommand: it collects TODOs
+// created within --window that no earlier digest covered, runs them
+// through GPT to produce a
+// summary grouped by tag and priority, and emails a single recap to
+// conf.Inbox.
+func runDigest(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("digest", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print the rendered digest instead of sending it")
+	window := fs.Duration("window", 7*24*time.Hour, "how far back to collect TODOs from")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := loadDigestSentStore()
+	if err != nil {
+		return fmt.Errorf("load digest store: %w", err)
+	}
+
+	entries, err := readHistory(time.Now().Add(-*window))
+	if err != nil {
+		return fmt.Errorf("read history: %w", err)
+	}
+
+	var fresh []historyEntry
+	for _, e := range entries {
+		if !store.Sent[historyKey(e)] {
+			fresh = append(fresh, e)
+		}
+	}
+	if len(fresh) == 0 {
+		fmt.Fprintf(os.Stdout, "todo: digest: nothing new since the last run\n")
+		return nil
+	}
+
+	var b strings.Builder
+	for _, e := range fresh {
+		fmt.Fprintf(&b, "- %s\n%s\n\n", e.Subject, e.Text)
+	}
+	summary := b.String()
+
+	resp, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: openai.ChatModelGPT4_1Nano2025_04_14,
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage("You are a helpful assistant that groups a list of TODOs into a short digest by tag and priority."),
+			openai.UserMessage(summary),
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "todo: digest: failed to generate GPT summary, falling back to raw list: %v\n", err)
+	} else {
+		summary = resp.Choices[0].Message.Content
+	}
+
+	if *dryRun {
+		fmt.Fprintf(os.Stdout, "%s\n", summary)
+		return nil
+	}
+
+	notifiers := buildNotifiers()
+	if len(notifiers) == 0 {
+		notifiers = []Notifier{&mailgunNotifier{from: conf.Email}}
+	}
+	notifyAll(ctx, notifiers, "todo: digest", summary, conf.Inbox)
+
+	for _, e := range fresh {
+		store.Sent[historyKey(e)] = true
+	}
+	return store.save()
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 Changkun Ou. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	htmlpkg "html"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// TodoStructured is the structured task GPT extracts from a raw TODO body
+// via function-calling, in place of the earlier free-form summary.
+type TodoStructured struct {
+	Title           string   `json:"title"`
+	DueDate         string   `json:"due_date,omitempty"`
+	Priority        string   `json:"priority,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	Subtasks        []string `json:"subtasks,omitempty"`
+	EstimatedEffort string   `json:"estimated_effort,omitempty"`
+}
+
+// extractFunctionName is the function GPT is asked to call to populate a
+// TodoStructured.
+const extractFunctionName = "extract_todo"
+
+var extractFunctionParams = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"title":            map[string]any{"type": "string"},
+		"due_date":         map[string]any{"type": "string", "description": "ISO-8601 due date, if mentioned"},
+		"priority":         map[string]any{"type": "string", "enum": []string{"low", "medium", "high"}},
+		"tags":             map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"subtasks":         map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"estimated_effort": map[string]any{"type": "string", "description": "rough estimate, e.g. \"30m\", \"2h\""},
+	},
+	"required": []string{"title"},
+}
+
+// extractCacheDir caches prompt -> response pairs keyed by the SHA256 of
+// the input text, so retries on the same body don't re-spend on GPT.
+var extractCacheDir = filepath.Join(os.Getenv("HOME"), ".todo", "extract-cache")
+
+func extractCacheKey(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func readExtractCache(text string) (*TodoStructured, bool) {
+	b, err := os.ReadFile(filepath.Join(extractCacheDir, extractCacheKey(text)+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var s TodoStructured
+	if json.Unmarshal(b, &s) != nil {
+		return nil, false
+	}
+	return &s, true
+}
+
+func writeExtractCache(text string, s *TodoStructured) error {
+	if err := os.MkdirAll(extractCacheDir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(extractCacheDir, extractCacheKey(text)+".json"), b, 0o644)
+}
+
+// extractStructuredTodo asks GPT to populate a TodoStructured from the raw
+// body captured by waitBody via function-calling, caching the result by
+// the SHA of the input. ok is false if the model didn't return a valid
+// structured call, in which case callers should fall back to the plain
+// free-form summary.
+func extractStructuredTodo(ctx context.Context, text string) (s *TodoStructured, ok bool) {
+	if cached, hit := readExtractCache(text); hit {
+		return cached, true
+	}
+
+	resp, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: openai.ChatModelGPT4_1Nano2025_04_14,
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage("Extract a structured TODO from the user's text by calling " + extractFunctionName + "."),
+			openai.UserMessage(text),
+		},
+		Tools: []openai.ChatCompletionToolUnionParam{
+			openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
+				Name:       extractFunctionName,
+				Parameters: extractFunctionParams,
+			}),
+		},
+		ToolChoice: openai.ToolChoiceOptionFunctionToolChoice(openai.ChatCompletionNamedToolChoiceFunctionParam{Name: extractFunctionName}),
+	})
+	if err != nil || len(resp.Choices) == 0 || len(resp.Choices[0].Message.ToolCalls) == 0 {
+		return nil, false
+	}
+
+	var out TodoStructured
+	args := resp.Choices[0].Message.ToolCalls[0].Function.Arguments
+	if json.Unmarshal([]byte(args), &out) != nil {
+		return nil, false
+	}
+
+	if err := writeExtractCache(text, &out); err != nil {
+		fmt.Fprintf(os.Stderr, "todo: failed to cache structured extraction: %v\n", err)
+	}
+	return &out, true
+}
+
+// renderStructuredEmail renders s as an HTML summary for mg.NewMessage's
+// HTML body, plus the raw JSON for machine consumers to attach. Every
+// field is HTML-escaped since it ultimately comes from GPT's reading of
+// user-supplied TODO text.
+func renderStructuredEmail(s *TodoStructured) (html string, rawJSON []byte) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<h3>%s</h3>\n", htmlpkg.EscapeString(s.Title))
+	if s.Priority != "" {
+		fmt.Fprintf(&b, "<p><b>Priority:</b> %s</p>\n", htmlpkg.EscapeString(s.Priority))
+	}
+	if s.DueDate != "" {
+		fmt.Fprintf(&b, "<p><b>Due:</b> %s</p>\n", htmlpkg.EscapeString(s.DueDate))
+	}
+	if s.EstimatedEffort != "" {
+		fmt.Fprintf(&b, "<p><b>Estimated effort:</b> %s</p>\n", htmlpkg.EscapeString(s.EstimatedEffort))
+	}
+	if len(s.Tags) > 0 {
+		escaped := make([]string, len(s.Tags))
+		for i, t := range s.Tags {
+			escaped[i] = htmlpkg.EscapeString(t)
+		}
+		fmt.Fprintf(&b, "<p><b>Tags:</b> %s</p>\n", strings.Join(escaped, ", "))
+	}
+	if len(s.Subtasks) > 0 {
+		b.WriteString("<p><b>Subtasks:</b></p>\n<ul>\n")
+		for _, t := range s.Subtasks {
+			fmt.Fprintf(&b, "<li>%s</li>\n", htmlpkg.EscapeString(t))
+		}
+		b.WriteString("</ul>\n")
+	}
+
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		raw = nil
+	}
+	return b.String(), raw
+}
+
+// sendStructuredEmail sends subject/html as an HTML TODO, attaching
+// rawJSON for machine consumers, honoring the same deferred-delivery and
+// STO options as sendEmail.
+func sendStructuredEmail(ctx context.Context, subject, html string, rawJSON []byte, inbox string, deliveryTime time.Time, stoPeriod string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	msg := &Message{Message: mg.NewMessage(conf.Email, subject, "", inbox), deliveryTime: deliveryTime, stoPeriod: stoPeriod}
+	msg.SetHtml(html)
+	msg.AddBufferAttachment("todo.json", rawJSON)
+	if err := msg.applyDelivery(); err != nil {
+		return err
+	}
+
+	_, _, err := mg.Send(ctx, msg.Message)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "todo: failed to send a structured TODO to %s: %v", conf.Person, err)
+		return err
+	}
+	return nil
+}
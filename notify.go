@@ -0,0 +1,184 @@
+// Copyright 2021 Changkun Ou. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sync"
+	"time"
+)
+
+// notifyMaxAttempts bounds how many times a single channel is attempted
+// before notifyAll gives up on it, so one dead channel can't stall the
+// others indefinitely.
+const notifyMaxAttempts = 3
+
+// Notifier delivers a TODO notification to a single channel.
+type Notifier interface {
+	Send(ctx context.Context, subject, body, recipient string) error
+}
+
+// channelConfig describes one configured notification channel, e.g. a
+// Mailgun domain, an SMTP relay, or a chat bot webhook. Creds holds
+// whatever credentials that channel's Key needs.
+type channelConfig struct {
+	Key   string            `yaml:"key"`
+	Label string            `yaml:"label"`
+	Creds map[string]string `yaml:"creds"`
+}
+
+// buildNotifiers constructs one Notifier per entry in conf.Channels,
+// skipping entries with an unrecognized key.
+func buildNotifiers() []Notifier {
+	var notifiers []Notifier
+	for _, ch := range conf.Channels {
+		switch ch.Key {
+		case "mailgun":
+			notifiers = append(notifiers, &mailgunNotifier{from: conf.Email})
+		case "smtp":
+			notifiers = append(notifiers, &smtpNotifier{
+				addr: ch.Creds["addr"],
+				from: ch.Creds["from"],
+				auth: smtp.PlainAuth("", ch.Creds["user"], ch.Creds["password"], ch.Creds["host"]),
+			})
+		case "telegram":
+			notifiers = append(notifiers, &telegramNotifier{token: ch.Creds["token"], chatID: ch.Creds["chat_id"]})
+		case "dingtalk", "feishu", "wecom":
+			notifiers = append(notifiers, &webhookNotifier{url: ch.Creds["webhook"], kind: ch.Key})
+		default:
+			fmt.Fprintf(os.Stderr, "todo: unknown notification channel %q (%s), skipping\n", ch.Key, ch.Label)
+		}
+	}
+	return notifiers
+}
+
+// notifyAll fans out subject/body to every configured notifier
+// concurrently, trying each channel up to notifyMaxAttempts times in all
+// on failure. Channels run independently, so a dead or misconfigured one
+// can't stall delivery to the rest.
+func notifyAll(ctx context.Context, notifiers []Notifier, subject, body, recipient string) {
+	var wg sync.WaitGroup
+	for _, n := range notifiers {
+		wg.Add(1)
+		go func(n Notifier) {
+			defer wg.Done()
+
+			var err error
+			for attempt := 1; attempt <= notifyMaxAttempts; attempt++ {
+				if err = n.Send(ctx, subject, body, recipient); err == nil {
+					return
+				}
+				if attempt == notifyMaxAttempts {
+					break
+				}
+				fmt.Fprintf(os.Stderr, "todo: notifier failed (attempt %d/%d), retry in 3 seconds: %v\n", attempt, notifyMaxAttempts, err)
+				time.Sleep(3 * time.Second)
+			}
+			fmt.Fprintf(os.Stderr, "todo: notifier gave up after %d attempts: %v\n", notifyMaxAttempts, err)
+		}(n)
+	}
+	wg.Wait()
+}
+
+// mailgunNotifier delivers through the package-level mg client. deliveryTime
+// and stoPeriod, when set, defer the send per --at/--in/--sto. htmlBody and
+// rawJSON, when set, switch the send to the richer structured-TODO format.
+type mailgunNotifier struct {
+	from         string
+	deliveryTime time.Time
+	stoPeriod    string
+	htmlBody     string
+	rawJSON      []byte
+}
+
+func (n *mailgunNotifier) Send(ctx context.Context, subject, body, recipient string) error {
+	if n.htmlBody != "" {
+		return sendStructuredEmail(ctx, subject, n.htmlBody, n.rawJSON, recipient, n.deliveryTime, n.stoPeriod)
+	}
+	return sendEmail(ctx, subject, body, recipient, n.deliveryTime, n.stoPeriod)
+}
+
+// smtpNotifier delivers through a plain SMTP relay.
+type smtpNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (n *smtpNotifier) Send(ctx context.Context, subject, body, recipient string) error {
+	msg := fmt.Appendf(nil, "Subject: %s\r\n\r\n%s", subject, body)
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{recipient}, msg)
+}
+
+// telegramNotifier delivers via a Telegram bot's sendMessage API.
+type telegramNotifier struct {
+	token  string
+	chatID string
+}
+
+func (n *telegramNotifier) Send(ctx context.Context, subject, body, recipient string) error {
+	payload, err := json.Marshal(map[string]string{
+		"chat_id": n.chatID,
+		"text":    subject + "\n\n" + body,
+	})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.token)
+	return postJSON(ctx, url, payload)
+}
+
+// webhookNotifier delivers a "text" message to a robot webhook. kind
+// selects the payload shape, since Feishu's custom-bot webhook doesn't
+// share Dingtalk/Wecom's format.
+type webhookNotifier struct {
+	url  string
+	kind string // "dingtalk", "feishu", or "wecom"
+}
+
+func (n *webhookNotifier) Send(ctx context.Context, subject, body, recipient string) error {
+	var payload any
+	switch n.kind {
+	case "feishu":
+		payload = map[string]any{
+			"msg_type": "text",
+			"content":  map[string]string{"text": subject + "\n" + body},
+		}
+	default: // dingtalk, wecom
+		payload = map[string]any{
+			"msgtype": "text",
+			"text":    map[string]string{"content": subject + "\n" + body},
+		}
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.url, b)
+}
+
+func postJSON(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	return nil
+}
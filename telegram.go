@@ -0,0 +1,156 @@
+// Copyright 2021 Changkun Ou. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// errNotATodoCommand indicates a Telegram update isn't a /todo command and
+// should be ignored.
+var errNotATodoCommand = errors.New("not a /todo command")
+
+// telegramUpdate is the minimal subset of Telegram's getUpdates payload
+// the bot cares about.
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+	} `json:"message"`
+}
+
+// telegramUpdatesResponse is Telegram's getUpdates response envelope.
+type telegramUpdatesResponse struct {
+	OK     bool             `json:"ok"`
+	Result []telegramUpdate `json:"result"`
+}
+
+// telegramToken returns the token of the configured telegram channel, or
+// "" if none is configured.
+func telegramToken() string {
+	for _, ch := range conf.Channels {
+		if ch.Key == "telegram" {
+			return ch.Creds["token"]
+		}
+	}
+	return ""
+}
+
+// commandFromUpdate turns a Telegram update into a todo if it carries a
+// /todo command, e.g. "/todo buy milk".
+func commandFromUpdate(upd telegramUpdate) (*todo, error) {
+	text := strings.TrimSpace(upd.Message.Text)
+	if !strings.HasPrefix(text, "/todo") {
+		return nil, errNotATodoCommand
+	}
+
+	subject := strings.TrimSpace(strings.TrimPrefix(text, "/todo"))
+	if subject == "" {
+		return nil, errCanceled
+	}
+	return &todo{subject: todoSubjectPrefix + subject}, nil
+}
+
+// getTelegramUpdates long-polls Telegram's getUpdates endpoint for
+// updates at or after offset.
+func getTelegramUpdates(ctx context.Context, token string, offset int64) ([]telegramUpdate, error) {
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/getUpdates?offset=%d&timeout=30", token, offset)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var out telegramUpdatesResponse
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("parse getUpdates response: %w", err)
+	}
+	if !out.OK {
+		return nil, fmt.Errorf("getUpdates: response not ok")
+	}
+	return out.Result, nil
+}
+
+// replyToTelegramChat sends a plain text message back to a chat, used to
+// confirm a /todo command was turned into a TODO.
+func replyToTelegramChat(ctx context.Context, token string, chatID int64, text string) error {
+	payload, err := json.Marshal(map[string]any{"chat_id": chatID, "text": text})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", token), payload)
+}
+
+// runTelegramBot long-polls Telegram for /todo commands, turns each one
+// into a TODO through the same pipeline used by the CLI, and replies in
+// the originating chat once it's sent, until it receives an interrupt
+// signal.
+func runTelegramBot(ctx context.Context) error {
+	token := telegramToken()
+	if token == "" {
+		return fmt.Errorf("no telegram channel configured")
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+
+	fmt.Fprintf(os.Stdout, "todo: telegram bot started, polling for /todo commands\n")
+	var offset int64
+	for {
+		select {
+		case <-sigCh:
+			fmt.Fprintf(os.Stdout, "todo: telegram bot shutting down\n")
+			return nil
+		default:
+		}
+
+		updates, err := getTelegramUpdates(ctx, token, offset)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "todo: telegram bot: %v\n", err)
+			time.Sleep(3 * time.Second)
+			continue
+		}
+
+		for _, upd := range updates {
+			offset = upd.UpdateID + 1
+
+			a, err := commandFromUpdate(upd)
+			if errors.Is(err, errNotATodoCommand) || errors.Is(err, errCanceled) {
+				continue
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "todo: telegram bot: %v\n", err)
+				continue
+			}
+
+			if err := sendTODO(ctx, a, time.Time{}, ""); err != nil {
+				fmt.Fprintf(os.Stderr, "todo: telegram bot: failed to record TODO history: %v\n", err)
+			}
+			if err := replyToTelegramChat(ctx, token, upd.Message.Chat.ID, "todo: created \""+a.subject+"\""); err != nil {
+				fmt.Fprintf(os.Stderr, "todo: telegram bot: failed to reply: %v\n", err)
+			}
+		}
+	}
+}
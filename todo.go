@@ -30,6 +30,16 @@ type config struct {
 	APIKey  string `yaml:"apikey"`
 	APIBase string `yaml:"apibase"`
 	Inbox   string `yaml:"inbox"`
+
+	// IMAP settings used by the daemon subcommand to poll for replies.
+	IMAPHost        string `yaml:"imap_host"`
+	IMAPUser        string `yaml:"imap_user"`
+	IMAPPassword    string `yaml:"imap_password"`
+	PollIntervalSec int    `yaml:"poll_interval_seconds"`
+
+	// Channels lists the notification channels a TODO fans out to. When
+	// empty, sending falls back to Mailgun alone.
+	Channels []channelConfig `yaml:"channels"`
 }
 
 var (
@@ -64,8 +74,16 @@ func init() {
 }
 
 func main() {
+	at := flag.String("at", "", "deliver at this RFC3339 timestamp instead of immediately")
+	in := flag.Duration("in", 0, "deliver after this duration instead of immediately")
+	sto := flag.String("sto", "", "enable Mailgun Send Time Optimization over this many hours, e.g. \"48h\" (24h-72h)")
+
 	flag.CommandLine.Usage = func() {
 		fmt.Fprintf(os.Stderr, `Usage: todo [ITEM]
+       todo [--at TIME|--in DURATION] [--sto PERIOD] [ITEM]
+       todo daemon
+       todo digest [--dry-run] [--window DURATION]
+       todo telegram
 > Further details.
 >
 SENT!
@@ -73,12 +91,34 @@ SENT!
 examples:
 $ todo need to do something
 $ todo "I've to do something"
+$ todo --in 2h need to do something
+$ todo daemon
+$ todo digest --dry-run
+$ todo telegram
 `)
 		flag.PrintDefaults()
 	}
 	flag.CommandLine.SetOutput(io.Discard)
 	flag.Parse()
 
+	switch flag.Arg(0) {
+	case "daemon":
+		if err := runDaemon(context.Background()); err != nil {
+			fatal("todo: daemon failed: %v", err)
+		}
+		return
+	case "digest":
+		if err := runDigest(context.Background(), flag.Args()[1:]); err != nil {
+			fatal("todo: digest failed: %v", err)
+		}
+		return
+	case "telegram":
+		if err := runTelegramBot(context.Background()); err != nil {
+			fatal("todo: telegram bot failed: %v", err)
+		}
+		return
+	}
+
 	subject := strings.Join(flag.Args(), " ")
 	if subject == "" {
 		fatal("todo: missing todo subject.")
@@ -95,46 +135,81 @@ $ todo "I've to do something"
 		fatal("todo: cannot created a TODO item: %v", err)
 	}
 
+	deliveryTime, err := parseDeliverAt(*at, *in)
+	if err != nil {
+		fatal("todo: %v", err)
+	}
+
+	if err := sendTODO(context.Background(), a, deliveryTime, *sto); err != nil {
+		fmt.Fprintf(os.Stderr, "todo: failed to record TODO history: %v\n", err)
+	}
+	fmt.Fprintf(os.Stdout, "\n todo: SENT!")
+}
+
+// sendTODO runs a through structured extraction (falling back to a plain
+// GPT summary), fans it out to every configured notifier, and records it
+// in the local history used by `todo digest`. This is the one pipeline
+// every TODO source (the CLI and the Telegram bot's /todo command) funnels
+// through.
+func sendTODO(ctx context.Context, a *todo, deliveryTime time.Time, stoPeriod string) error {
 	text := a.subject
 	if len(a.text) != 0 {
 		text = strings.Join(a.text, "\n")
 	}
 
-	fmt.Fprintf(os.Stdout, "todo: generating GPT suggestion...\n")
-	resp, err := client.Chat.Completions.New(
-		context.Background(),
-		openai.ChatCompletionNewParams{
-			Model: openai.ChatModelGPT4_1Nano2025_04_14,
-			Messages: []openai.ChatCompletionMessageParamUnion{
-				openai.SystemMessage("You are a helpful assistant that helps summarize the given text."),
-				openai.UserMessage(text),
-			},
-		},
-	)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "todo: failed to generate GPT suggestion: %v", err)
+	var htmlBody string
+	var rawJSON []byte
+	fmt.Fprintf(os.Stdout, "todo: extracting structured TODO...\n")
+	if structured, ok := extractStructuredTodo(ctx, text); ok {
+		htmlBody, rawJSON = renderStructuredEmail(structured)
 	} else {
-		text += "\n\nSuggestion by GPT4:\n" + resp.Choices[0].Message.Content + "\n"
+		fmt.Fprintf(os.Stdout, "todo: falling back to GPT suggestion...\n")
+		resp, err := client.Chat.Completions.New(
+			ctx,
+			openai.ChatCompletionNewParams{
+				Model: openai.ChatModelGPT4_1Nano2025_04_14,
+				Messages: []openai.ChatCompletionMessageParamUnion{
+					openai.SystemMessage("You are a helpful assistant that helps summarize the given text."),
+					openai.UserMessage(text),
+				},
+			},
+		)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "todo: failed to generate GPT suggestion: %v", err)
+		} else {
+			text += "\n\nSuggestion by GPT4:\n" + resp.Choices[0].Message.Content + "\n"
+		}
 	}
 
-	for {
-		err := sendEmail(context.Background(), a.subject, text, conf.Inbox)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "todo: failed to send email, retry in 3 seconds...")
-			time.Sleep(3 * time.Second)
-			continue
+	notifiers := buildNotifiers()
+	if len(notifiers) == 0 {
+		notifiers = []Notifier{&mailgunNotifier{from: conf.Email}}
+	}
+	for _, n := range notifiers {
+		if mgn, ok := n.(*mailgunNotifier); ok {
+			mgn.deliveryTime = deliveryTime
+			mgn.stoPeriod = stoPeriod
+			mgn.htmlBody = htmlBody
+			mgn.rawJSON = rawJSON
 		}
-		break
 	}
-	fmt.Fprintf(os.Stdout, "\n todo: SENT!")
+	notifyAll(ctx, notifiers, a.subject, text, conf.Inbox)
+	return recordSent(a.subject, text, time.Now())
 }
 
-func sendEmail(ctx context.Context, subject, text string, inbox string) error {
+// sendEmail sends a plain-text TODO through Mailgun, optionally deferring
+// delivery to deliveryTime or enabling Send Time Optimization over
+// stoPeriod (e.g. "48h"). Either may be the zero value to send normally.
+func sendEmail(ctx context.Context, subject, text, inbox string, deliveryTime time.Time, stoPeriod string) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	msg := mg.NewMessage(conf.Email, subject, text, inbox)
-	_, _, err := mg.Send(ctx, msg)
+	msg := &Message{Message: mg.NewMessage(conf.Email, subject, text, inbox), deliveryTime: deliveryTime, stoPeriod: stoPeriod}
+	if err := msg.applyDelivery(); err != nil {
+		return err
+	}
+
+	_, _, err := mg.Send(ctx, msg.Message)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "todo: failed to send a TODO to %s: %v", conf.Person, err)
 		return err